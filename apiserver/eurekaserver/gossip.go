@@ -0,0 +1,397 @@
+/**
+ * Tencent is pleased to support the open source community by making Polaris available.
+ *
+ * Copyright (C) 2019 THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * Licensed under the BSD 3-Clause License (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * https://opensource.org/licenses/BSD-3-Clause
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package eurekaserver
+
+import (
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/emicklei/go-restful/v3"
+)
+
+const (
+	// defaultMaxHops bounds how many times a gossiped instance is re-forwarded before
+	// it is dropped, preventing unbounded propagation in a partially connected mesh.
+	defaultMaxHops = 3
+	// defaultGossipFanout is how many random peers an accepted instance is forwarded to.
+	defaultGossipFanout = 2
+	// defaultAntiEntropyInterval is how often each node picks a random peer and
+	// reconciles divergent apps via a Merkle-style digest exchange.
+	defaultAntiEntropyInterval = 30 * time.Second
+)
+
+// gossipPeer is one member of the replication mesh this node knows about.
+type gossipPeer struct {
+	NodeID string
+	Addr   string
+}
+
+// vectorClock tracks, per origin node id, the highest LastDirtyTimestamp-derived counter
+// this node has observed for a given (app, instance). Received instances are still kept
+// out of the star broadcast by the MetadataReplicate check in shouldReplicate; for gossip
+// re-forwarding, we use the clock to tell whether a received update is actually new.
+type vectorClock map[string]uint64
+
+// dominates reports whether vc is at least as advanced as other on every node and
+// strictly ahead on at least one, i.e. vc causally dominates other. Any clock, an empty
+// one included, dominates an empty clock, so the first delivery for a key is accepted.
+func (vc vectorClock) dominates(other vectorClock) bool {
+	aheadOnOne := false
+	for node, count := range other {
+		if vc[node] < count {
+			return false
+		}
+		if vc[node] > count {
+			aheadOnOne = true
+		}
+	}
+	for node, count := range vc {
+		if _, ok := other[node]; !ok && count > 0 {
+			aheadOnOne = true
+		}
+	}
+	return aheadOnOne || len(other) == 0
+}
+
+// merge returns the component-wise max of vc and other, i.e. the join of both clocks.
+func (vc vectorClock) merge(other vectorClock) vectorClock {
+	merged := make(vectorClock, len(vc)+len(other))
+	for node, count := range vc {
+		merged[node] = count
+	}
+	for node, count := range other {
+		if count > merged[node] {
+			merged[node] = count
+		}
+	}
+	return merged
+}
+
+// gossipKey identifies the (app, instance) a vector clock is tracked against.
+func gossipKey(appName, instanceID string) string {
+	return appName + "/" + instanceID
+}
+
+// gossipClockStore keeps the last-applied vector clock per (app, instance) so dispatch
+// can tell a stale re-delivery from a genuinely new update.
+type gossipClockStore struct {
+	mu     sync.Mutex
+	clocks map[string]vectorClock
+}
+
+func newGossipClockStore() *gossipClockStore {
+	return &gossipClockStore{clocks: make(map[string]vectorClock)}
+}
+
+// observe reports whether incoming dominates the previously recorded clock for key, and
+// if so records the merged clock as the new baseline.
+func (s *gossipClockStore) observe(key string, incoming vectorClock) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	existing := s.clocks[key]
+	if !incoming.dominates(existing) {
+		return false
+	}
+	s.clocks[key] = existing.merge(incoming)
+	return true
+}
+
+// gossipEnvelope carries the mesh-routing metadata for a ReplicationInstance. It travels
+// only as the X-Polaris-Gossip request header (JSON-encoded), set by sendWithEnvelope when
+// the envelope has an origin; a request without it gets a per-instance fallback envelope.
+type gossipEnvelope struct {
+	OriginNodeID string      `json:"originNodeId"`
+	VectorClock  vectorClock `json:"vectorClock"`
+	HopCount     int         `json:"hopCount"`
+}
+
+const headerGossipEnvelope = "X-Polaris-Gossip"
+
+// fallbackGossipCounter hands out a monotonically increasing logical clock value, never
+// below the current wall-clock milliseconds so it orders on the same scale as
+// LastDirtyTimestamp, for instances that carry no usable LastDirtyTimestamp (e.g. a cancel), so that repeated
+// deliveries of the same instance from a non-gossip-aware sender are never mistaken for
+// a stale duplicate of one another - see buildFallbackEnvelope.
+var fallbackGossipCounter uint64
+
+// parseGossipEnvelopeHeader decodes the X-Polaris-Gossip header a gossip-aware peer
+// attaches to its BatchReplication call. ok is false when the header is absent or
+// malformed, in which case the caller must derive an envelope per instance instead
+// (buildFallbackEnvelope), since a single shared counter cannot correctly order an
+// entire batch of distinct instances.
+func parseGossipEnvelopeHeader(req *restful.Request) (envelope gossipEnvelope, ok bool) {
+	raw := req.HeaderParameter(headerGossipEnvelope)
+	if raw == "" {
+		return gossipEnvelope{}, false
+	}
+	if err := json.Unmarshal([]byte(raw), &envelope); err != nil {
+		log.Warnf("[EUREKA-SERVER] fail to parse %s header, falling back to star semantics, err: %v",
+			headerGossipEnvelope, err)
+		return gossipEnvelope{}, false
+	}
+	return envelope, true
+}
+
+// buildFallbackEnvelope synthesizes a zero-hop envelope for a peer that doesn't send
+// the gossip header yet (e.g. during a rolling upgrade), so the cluster degrades to the
+// previous star broadcast behaviour instead of rejecting the replication outright. The
+// clock value must strictly increase across successive deliveries of the same instance
+// or every delivery after the first will be misjudged as a stale duplicate by
+// vectorClock.dominates and silently dropped; LastDirtyTimestamp already satisfies that
+// for actions that set it, and the shared monotonic counter covers the rest (cancel).
+func buildFallbackEnvelope(originNodeID string, instance *ReplicationInstance) gossipEnvelope {
+	counter := uint64(instance.LastDirtyTimestamp)
+	if counter == 0 {
+		now := uint64(time.Now().UnixMilli())
+		for {
+			prev := atomic.LoadUint64(&fallbackGossipCounter)
+			next := prev + 1
+			if now > next {
+				next = now
+			}
+			if atomic.CompareAndSwapUint64(&fallbackGossipCounter, prev, next) {
+				counter = next
+				break
+			}
+		}
+	}
+	return gossipEnvelope{OriginNodeID: originNodeID, VectorClock: vectorClock{originNodeID: counter}}
+}
+
+// resolveGossipEnvelope returns headerEnvelope as-is when the sender attached one, and
+// otherwise builds a correctly-ordered fallback envelope for instance.
+func resolveGossipEnvelope(
+	headerEnvelope gossipEnvelope, haveHeader bool, originNodeID string, instance *ReplicationInstance) gossipEnvelope {
+	if haveHeader {
+		return headerEnvelope
+	}
+	return buildFallbackEnvelope(originNodeID, instance)
+}
+
+// nextHop advances the envelope for re-forwarding: the hop count increases, the vector
+// clock gains this node's own stamp so downstream nodes can detect the edge it travelled.
+func (g gossipEnvelope) nextHop(localNodeID string, localCounter uint64) gossipEnvelope {
+	vc := g.VectorClock.merge(vectorClock{localNodeID: localCounter})
+	return gossipEnvelope{OriginNodeID: g.OriginNodeID, VectorClock: vc, HopCount: g.HopCount + 1}
+}
+
+// shouldApplyGossip decides whether a received instance represents a causally new update.
+// Unlike the MetadataReplicate check in shouldReplicate, which keeps received instances
+// out of the star broadcast, this is what lets the same instance circulate through several hops without being treated as a duplicate loop:
+// each hop is accepted exactly once, based on clock dominance rather than provenance.
+func (h *EurekaServer) shouldApplyGossip(appName, instanceID string, envelope gossipEnvelope) bool {
+	return h.gossipClocks.observe(gossipKey(appName, instanceID), envelope.VectorClock)
+}
+
+// forwardGossip re-broadcasts an accepted instance to up to defaultGossipFanout randomly
+// chosen peers (excluding the origin), provided the envelope has hops left to spend. It
+// handles instances received from a peer; locally-originated events are still
+// star-broadcast by replicateWorker.AddReplicateTask. A received instance keeps moving
+// through the mesh instead of stopping at the first hop.
+func (h *EurekaServer) forwardGossip(instance *ReplicationInstance, envelope gossipEnvelope) {
+	if envelope.HopCount >= defaultMaxHops {
+		return
+	}
+	peers := h.pickGossipPeers(envelope.OriginNodeID, defaultGossipFanout)
+	next := envelope.nextHop(h.nodeID, uint64(time.Now().UnixMilli()))
+	for _, peer := range peers {
+		h.replicateWorker.AddReplicateTaskToPeer(peer.Addr, instance, next)
+	}
+}
+
+// pickGossipPeers returns up to n random peers from the known mesh, excluding excludeNodeID.
+func (h *EurekaServer) pickGossipPeers(excludeNodeID string, n int) []gossipPeer {
+	candidates := make([]gossipPeer, 0, len(h.gossipPeers))
+	for _, p := range h.gossipPeers {
+		if p.NodeID != excludeNodeID {
+			candidates = append(candidates, p)
+		}
+	}
+	rand.Shuffle(len(candidates), func(i, j int) { candidates[i], candidates[j] = candidates[j], candidates[i] })
+	if len(candidates) > n {
+		candidates = candidates[:n]
+	}
+	return candidates
+}
+
+// appDigest is one bucket of the Merkle-style digest exchanged during anti-entropy: a
+// hash over every (instanceId, lastDirtyTimestamp) pair known for one app.
+type appDigest struct {
+	AppName string `json:"appName"`
+	Hash    string `json:"hash"`
+}
+
+// digestResponse is the body returned by HandleDigest.
+type digestResponse struct {
+	NodeID  string      `json:"nodeId"`
+	Digests []appDigest `json:"digests"`
+}
+
+// buildLocalDigests computes one appDigest per app currently known to this node's cache.
+func (h *EurekaServer) buildLocalDigests() []appDigest {
+	apps := h.appCache.listApps()
+	digests := make([]appDigest, 0, len(apps))
+	for _, appName := range apps {
+		cachedApp := h.appCache.getApp(appName)
+		if cachedApp == nil {
+			continue
+		}
+		type bucketEntry struct {
+			id        string
+			dirtyTime int64
+		}
+		var entries []bucketEntry
+		for _, inst := range cachedApp.getInstances() {
+			entries = append(entries, bucketEntry{id: inst.InstanceId, dirtyTime: inst.LastDirtyTimestamp})
+		}
+		sort.Slice(entries, func(i, j int) bool { return entries[i].id < entries[j].id })
+		h2 := sha1.New()
+		for _, e := range entries {
+			_, _ = fmt.Fprintf(h2, "%s:%d;", e.id, e.dirtyTime)
+		}
+		digests = append(digests, appDigest{AppName: appName, Hash: fmt.Sprintf("%x", h2.Sum(nil))})
+	}
+	return digests
+}
+
+// HandleDigest returns this node's per-app Merkle-style digest so a peer running its
+// anti-entropy sweep can detect which apps have diverged without transferring full state.
+// GET /eureka/v1/replication/digest
+func (h *EurekaServer) HandleDigest(req *restful.Request, rsp *restful.Response) {
+	_ = rsp.WriteAsJson(digestResponse{NodeID: h.nodeID, Digests: h.buildLocalDigests()})
+}
+
+// registerGossipRoutes wires the anti-entropy digest exchange endpoint onto ws. It is
+// invoked from RegisterEurekaExtensionRoutes, not called directly.
+func (h *EurekaServer) registerGossipRoutes(ws *restful.WebService) {
+	ws.Route(ws.GET("/v1/replication/digest").To(h.HandleDigest))
+}
+
+// RegisterEurekaExtensionRoutes wires every route added on top of the native Eureka
+// registration/query endpoints: the replication dead-letter admin API, the WebSocket/SSE
+// watch endpoints, and the anti-entropy digest endpoint. The apiserver bootstrap that
+// builds this package's *restful.WebService (alongside the existing /v1/apps and
+// /v1/peerreplication/batch routes) must call this once so these endpoints are actually
+// reachable; none of them self-register.
+func (h *EurekaServer) RegisterEurekaExtensionRoutes(ws *restful.WebService) {
+	h.registerGossipRoutes(ws)
+	h.registerReplicationAdminRoutes(ws)
+	h.registerPushRoutes(ws)
+}
+
+// runAntiEntropy periodically picks one random peer, compares per-app digests, and
+// replicates only the apps whose digest has diverged, so a node that missed updates
+// during a partition catches back up without a full-state resync.
+func (h *EurekaServer) runAntiEntropy(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(defaultAntiEntropyInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+			peers := h.pickGossipPeers(h.nodeID, 1)
+			if len(peers) == 0 {
+				continue
+			}
+			h.reconcileWithPeer(peers[0])
+		}
+	}
+}
+
+// reconcileWithPeer fetches peer's digest, diffs it against the local one, and triggers a
+// targeted BatchReplication of the instances belonging to every app whose hash differs.
+func (h *EurekaServer) reconcileWithPeer(peer gossipPeer) {
+	peerDigests, err := h.fetchPeerDigest(peer)
+	if err != nil {
+		log.Warnf("[EUREKA-SERVER] anti-entropy: fail to fetch digest from peer %s (%s), err: %v",
+			peer.NodeID, peer.Addr, err)
+		return
+	}
+	local := make(map[string]string, len(h.buildLocalDigests()))
+	for _, d := range h.buildLocalDigests() {
+		local[d.AppName] = d.Hash
+	}
+	// an app the peer reported no digest for has diverged too
+	reported := make(map[string]bool, len(peerDigests))
+	for _, d := range peerDigests {
+		reported[d.AppName] = true
+	}
+	for appName := range local {
+		if !reported[appName] {
+			peerDigests = append(peerDigests, appDigest{AppName: appName})
+		}
+	}
+	for _, remote := range peerDigests {
+		if local[remote.AppName] == remote.Hash {
+			continue
+		}
+		log.Infof("[EUREKA-SERVER] anti-entropy: app %s diverged from peer %s, replicating divergent instances",
+			remote.AppName, peer.NodeID)
+		for _, instance := range h.buildReplicationInstancesForApp(remote.AppName) {
+			h.replicateWorker.AddReplicateTaskToPeer(peer.Addr, instance, gossipEnvelope{
+				OriginNodeID: h.nodeID,
+				VectorClock:  vectorClock{h.nodeID: uint64(instance.LastDirtyTimestamp)},
+			})
+		}
+	}
+}
+
+// buildReplicationInstancesForApp converts every instance currently cached for appName
+// into a register-action ReplicationInstance, used by anti-entropy to resync a bucket
+// that diverged from a peer's digest.
+func (h *EurekaServer) buildReplicationInstancesForApp(appName string) []*ReplicationInstance {
+	cachedApp := h.appCache.getApp(appName)
+	if cachedApp == nil {
+		return nil
+	}
+	instances := cachedApp.getInstances()
+	out := make([]*ReplicationInstance, 0, len(instances))
+	for _, inst := range instances {
+		out = append(out, &ReplicationInstance{
+			AppName:            appName,
+			Id:                 inst.InstanceId,
+			LastDirtyTimestamp: inst.LastDirtyTimestamp,
+			Status:             StatusUp,
+			InstanceInfo:       inst,
+			Action:             actionRegister,
+		})
+	}
+	return out
+}
+
+// fetchPeerDigest calls peer's /eureka/v1/replication/digest endpoint. The HTTP client
+// used for peer-to-peer calls already exists on replicateWorker for native replication;
+// this reuses the same transport rather than standing up a second one.
+func (h *EurekaServer) fetchPeerDigest(peer gossipPeer) ([]appDigest, error) {
+	body, err := h.replicateWorker.Get(peer.Addr + "/eureka/v1/replication/digest")
+	if err != nil {
+		return nil, err
+	}
+	var resp digestResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("fail to decode digest response from %s: %w", peer.Addr, err)
+	}
+	return resp.Digests, nil
+}
@@ -0,0 +1,119 @@
+/**
+ * Tencent is pleased to support the open source community by making Polaris available.
+ *
+ * Copyright (C) 2019 THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * Licensed under the BSD 3-Clause License (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * https://opensource.org/licenses/BSD-3-Clause
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package eurekaserver
+
+import (
+	"testing"
+
+	"github.com/emicklei/go-restful/v3"
+)
+
+func TestVectorClockDominates(t *testing.T) {
+	cases := []struct {
+		name  string
+		vc    vectorClock
+		other vectorClock
+		want  bool
+	}{
+		{"anything dominates an empty clock", vectorClock{"n1": 1}, vectorClock{}, true},
+		{"identical clocks do not dominate", vectorClock{"n1": 1}, vectorClock{"n1": 1}, false},
+		{"strictly greater on one node dominates", vectorClock{"n1": 2}, vectorClock{"n1": 1}, true},
+		{"strictly smaller does not dominate", vectorClock{"n1": 1}, vectorClock{"n1": 2}, false},
+		{"missing a node present in other does not dominate", vectorClock{"n1": 5}, vectorClock{"n1": 5, "n2": 1}, false},
+		{"extra node with positive count dominates", vectorClock{"n1": 1, "n2": 1}, vectorClock{"n1": 1}, true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := c.vc.dominates(c.other); got != c.want {
+				t.Errorf("dominates(%v, %v) = %v, want %v", c.vc, c.other, got, c.want)
+			}
+		})
+	}
+}
+
+func TestGossipClockStoreObserveAcceptsStrictlyIncreasingFallbackClocks(t *testing.T) {
+	store := newGossipClockStore()
+	key := gossipKey("app", "inst-1")
+
+	first := buildFallbackEnvelope("nodeA", &ReplicationInstance{LastDirtyTimestamp: 100})
+	if !store.observe(key, first.VectorClock) {
+		t.Fatalf("first delivery for %s should be accepted", key)
+	}
+
+	// Regression test: a second delivery for the same instance from the same
+	// non-gossip-aware sender must not be rejected as a stale duplicate just because
+	// both deliveries came from the same origin node.
+	second := buildFallbackEnvelope("nodeA", &ReplicationInstance{LastDirtyTimestamp: 200})
+	if !store.observe(key, second.VectorClock) {
+		t.Fatalf("second delivery with a later LastDirtyTimestamp should be accepted, not treated as stale")
+	}
+
+	// A genuinely stale re-delivery (older or equal timestamp) must still be rejected.
+	stale := buildFallbackEnvelope("nodeA", &ReplicationInstance{LastDirtyTimestamp: 150})
+	if store.observe(key, stale.VectorClock) {
+		t.Errorf("stale delivery with an older LastDirtyTimestamp should be rejected")
+	}
+}
+
+func TestBuildFallbackEnvelopeUsesMonotonicCounterWhenNoDirtyTimestamp(t *testing.T) {
+	first := buildFallbackEnvelope("nodeA", &ReplicationInstance{})
+	second := buildFallbackEnvelope("nodeA", &ReplicationInstance{})
+	if second.VectorClock["nodeA"] <= first.VectorClock["nodeA"] {
+		t.Errorf("fallback counter should strictly increase across calls with no LastDirtyTimestamp: first=%d second=%d",
+			first.VectorClock["nodeA"], second.VectorClock["nodeA"])
+	}
+}
+
+// TestRegisterEurekaExtensionRoutesRegistersEveryExtensionEndpoint proves the single
+// aggregator hook the apiserver bootstrap is meant to call actually wires up the digest,
+// DLQ admin, and watch/events endpoints added across the replication series. Taking the
+// handlers as method values never dereferences h, so a nil *EurekaServer is enough to
+// exercise the real registration path without a live server instance.
+func TestRegisterEurekaExtensionRoutesRegistersEveryExtensionEndpoint(t *testing.T) {
+	var h *EurekaServer
+	ws := new(restful.WebService).Path("/eureka")
+	h.RegisterEurekaExtensionRoutes(ws)
+
+	want := map[string]bool{
+		"GET /eureka/v1/replication/digest":     false,
+		"GET /eureka/v1/replication/dlq":        false,
+		"POST /eureka/v1/replication/dlq/retry": false,
+		"DELETE /eureka/v1/replication/dlq":     false,
+		"GET /eureka/v1/apps/{appName}/watch":   false,
+		"GET /eureka/v1/apps/{appName}/events":  false,
+	}
+	for _, route := range ws.Routes() {
+		key := route.Method + " " + route.Path
+		if _, ok := want[key]; ok {
+			want[key] = true
+		}
+	}
+	for route, found := range want {
+		if !found {
+			t.Errorf("RegisterEurekaExtensionRoutes did not register expected route %q", route)
+		}
+	}
+}
+
+func TestResolveGossipEnvelopePrefersHeaderWhenPresent(t *testing.T) {
+	header := gossipEnvelope{OriginNodeID: "remote", HopCount: 2}
+	got := resolveGossipEnvelope(header, true, "local", &ReplicationInstance{LastDirtyTimestamp: 42})
+	if got.OriginNodeID != "remote" || got.HopCount != 2 {
+		t.Errorf("resolveGossipEnvelope should return the header envelope unchanged, got %+v", got)
+	}
+}
@@ -0,0 +1,354 @@
+/**
+ * Tencent is pleased to support the open source community by making Polaris available.
+ *
+ * Copyright (C) 2019 THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * Licensed under the BSD 3-Clause License (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * https://opensource.org/licenses/BSD-3-Clause
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package eurekaserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emicklei/go-restful/v3"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// pushQueueSize is the bounded per-connection backlog; once full the oldest queued
+	// event is dropped and a resync marker is queued at the tail in place of the new event.
+	pushQueueSize = 256
+	// pushHeartbeatInterval is how often idle connections receive a keep-alive frame.
+	pushHeartbeatInterval = 30 * time.Second
+	// pushRecentBufferSize is how many recent events per app are retained to serve
+	// Last-Event-ID/cursor based resume requests.
+	pushRecentBufferSize = 500
+)
+
+// pushEvent is the JSON frame sent to subscribers over both the WebSocket and SSE
+// transports, keyed the same way as the REST /apps response so clients can reuse one
+// decoder for snapshot and streamed payloads.
+type pushEvent struct {
+	Type     string        `json:"type"` // "snapshot", "update", "resync", "heartbeat"
+	AppName  string        `json:"appName,omitempty"`
+	Action   string        `json:"action,omitempty"`
+	Instance *InstanceInfo `json:"instance,omitempty"`
+	Cursor   int64         `json:"cursor,omitempty"`
+}
+
+// pushSubscriber is a single watch/events connection, filtered to a set of app names and
+// fed through a bounded queue so a slow client cannot block event fan-out to others.
+type pushSubscriber struct {
+	apps   map[string]bool
+	queue  chan *pushEvent
+	closed chan struct{}
+	once   sync.Once
+}
+
+func newPushSubscriber(apps []string) *pushSubscriber {
+	appSet := make(map[string]bool, len(apps))
+	for _, a := range apps {
+		appSet[formatReadName(strings.TrimSpace(a))] = true
+	}
+	return &pushSubscriber{
+		apps:   appSet,
+		queue:  make(chan *pushEvent, pushQueueSize),
+		closed: make(chan struct{}),
+	}
+}
+
+func (s *pushSubscriber) matches(appName string) bool {
+	if len(s.apps) == 0 {
+		return true
+	}
+	return s.apps[formatReadName(appName)]
+}
+
+// offer enqueues evt, dropping the oldest queued event and substituting a "resync" marker
+// when the subscriber's queue is full rather than blocking the publisher.
+func (s *pushSubscriber) offer(evt *pushEvent) {
+	select {
+	case s.queue <- evt:
+		return
+	default:
+	}
+	select {
+	case <-s.queue:
+	default:
+	}
+	select {
+	case s.queue <- &pushEvent{Type: "resync", AppName: evt.AppName}:
+	default:
+	}
+}
+
+func (s *pushSubscriber) close() {
+	s.once.Do(func() { close(s.closed) })
+}
+
+// recentEvent is a ring entry kept per app so a client resuming via Last-Event-ID/cursor
+// can replay everything it missed since its last seen LastDirtyTimestamp.
+type recentEvent struct {
+	cursor int64
+	evt    *pushEvent
+}
+
+// pushHub fans instance change events out to every subscribed watch/SSE connection and
+// retains a short per-app history to support resume-from-cursor.
+type pushHub struct {
+	mu          sync.RWMutex
+	subscribers map[*pushSubscriber]struct{}
+	recent      map[string][]recentEvent
+}
+
+func newPushHub() *pushHub {
+	return &pushHub{
+		subscribers: make(map[*pushSubscriber]struct{}),
+		recent:      make(map[string][]recentEvent),
+	}
+}
+
+func (h *pushHub) subscribe(sub *pushSubscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.subscribers[sub] = struct{}{}
+}
+
+func (h *pushHub) unsubscribe(sub *pushSubscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.subscribers, sub)
+}
+
+// publish fans a ReplicationInstance out to every matching subscriber and records it in
+// the per-app recent buffer, keyed by LastDirtyTimestamp as the resume cursor. Actions
+// carrying no InstanceInfo (cancel, status updates) still publish so watchers learn of
+// the change, just without a full instance payload.
+func (h *pushHub) publish(appName string, rInstance *ReplicationInstance) {
+	evt := &pushEvent{
+		Type:     "update",
+		AppName:  appName,
+		Action:   rInstance.Action,
+		Instance: rInstance.InstanceInfo,
+		Cursor:   rInstance.LastDirtyTimestamp,
+	}
+
+	h.mu.Lock()
+	buf := append(h.recent[appName], recentEvent{cursor: evt.Cursor, evt: evt})
+	if len(buf) > pushRecentBufferSize {
+		buf = buf[len(buf)-pushRecentBufferSize:]
+	}
+	h.recent[appName] = buf
+	subs := make([]*pushSubscriber, 0, len(h.subscribers))
+	for sub := range h.subscribers {
+		subs = append(subs, sub)
+	}
+	h.mu.Unlock()
+
+	for _, sub := range subs {
+		if sub.matches(appName) {
+			sub.offer(evt)
+		}
+	}
+}
+
+// since returns every recorded event for appName with a cursor strictly greater than
+// afterCursor, used to catch a resuming client up before it starts streaming live events.
+func (h *pushHub) since(appName string, afterCursor int64) []*pushEvent {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	var out []*pushEvent
+	for _, re := range h.recent[appName] {
+		if re.cursor > afterCursor {
+			out = append(out, re.evt)
+		}
+	}
+	return out
+}
+
+var pushUpgrader = websocket.Upgrader{
+	ReadBufferSize:  4096,
+	WriteBufferSize: 4096,
+	CheckOrigin:     func(r *http.Request) bool { return true },
+}
+
+// parseWatchApps splits the ?apps=a,b,c query parameter, falling back to the single
+// {appName} path parameter when apps is absent so one-app subscriptions need no query string.
+func parseWatchApps(req *restful.Request) []string {
+	if raw := req.QueryParameter("apps"); raw != "" {
+		return strings.Split(raw, ",")
+	}
+	if name := req.PathParameter("appName"); name != "" {
+		return []string{name}
+	}
+	return nil
+}
+
+// parseResumeCursor resolves the client's last-seen position from either the SSE
+// Last-Event-ID header or a `cursor` query parameter, both holding a LastDirtyTimestamp.
+func parseResumeCursor(req *restful.Request) int64 {
+	raw := req.HeaderParameter("Last-Event-ID")
+	if raw == "" {
+		raw = req.QueryParameter("cursor")
+	}
+	if raw == "" {
+		return 0
+	}
+	cursor, _ := strconv.ParseInt(raw, 10, 64)
+	return cursor
+}
+
+// snapshotFor builds the initial full-state frame for apps from the existing app cache,
+// mirroring the instance shape served by GET /apps/{appName}.
+func (h *EurekaServer) snapshotFor(apps []string) []*pushEvent {
+	var snapshot []*pushEvent
+	for _, app := range apps {
+		appName := formatReadName(strings.TrimSpace(app))
+		cachedApp := h.appCache.getApp(appName)
+		if cachedApp == nil {
+			continue
+		}
+		for _, instance := range cachedApp.getInstances() {
+			snapshot = append(snapshot, &pushEvent{
+				Type:     "snapshot",
+				AppName:  appName,
+				Instance: instance,
+				Cursor:   instance.LastDirtyTimestamp,
+			})
+		}
+	}
+	return snapshot
+}
+
+// HandleWatch upgrades to a WebSocket and streams instance change events for one or more
+// apps, starting with a cache snapshot, then any missed events (cursor/Last-Event-ID), then
+// live updates. GET /eureka/v1/apps/{appName}/watch?apps=a,b,c
+func (h *EurekaServer) HandleWatch(req *restful.Request, rsp *restful.Response) {
+	apps := parseWatchApps(req)
+	conn, err := pushUpgrader.Upgrade(rsp.ResponseWriter, req.Request, nil)
+	if err != nil {
+		log.Errorf("[EUREKA-SERVER] fail to upgrade watch websocket, client: %s, err: %v", req.Request.RemoteAddr, err)
+		return
+	}
+	defer func() { _ = conn.Close() }()
+
+	sub := newPushSubscriber(apps)
+	h.pushHub.subscribe(sub)
+	defer h.pushHub.unsubscribe(sub)
+
+	cursor := parseResumeCursor(req)
+	for _, evt := range h.snapshotFor(apps) {
+		if err := conn.WriteJSON(evt); err != nil {
+			return
+		}
+	}
+	for _, app := range apps {
+		for _, evt := range h.pushHub.since(formatReadName(strings.TrimSpace(app)), cursor) {
+			if err := conn.WriteJSON(evt); err != nil {
+				return
+			}
+		}
+	}
+
+	ticker := time.NewTicker(pushHeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case evt, ok := <-sub.queue:
+			if !ok {
+				return
+			}
+			if err := conn.WriteJSON(evt); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if err := conn.WriteJSON(&pushEvent{Type: "heartbeat"}); err != nil {
+				return
+			}
+		case <-sub.closed:
+			return
+		}
+	}
+}
+
+// HandleEvents streams instance change events for one or more apps as Server-Sent Events,
+// following the same snapshot -> resume -> live sequencing as HandleWatch.
+// GET /eureka/v1/apps/{appName}/events?apps=a,b,c
+func (h *EurekaServer) HandleEvents(req *restful.Request, rsp *restful.Response) {
+	apps := parseWatchApps(req)
+	flusher, ok := rsp.ResponseWriter.(http.Flusher)
+	if !ok {
+		writeHeader(http.StatusInternalServerError, rsp)
+		return
+	}
+	rsp.Header().Set("Content-Type", "text/event-stream")
+	rsp.Header().Set("Cache-Control", "no-cache")
+	rsp.Header().Set("Connection", "keep-alive")
+	rsp.WriteHeader(http.StatusOK)
+
+	writeSSE := func(evt *pushEvent) bool {
+		data, err := json.Marshal(evt)
+		if err != nil {
+			return true
+		}
+		if evt.Cursor > 0 {
+			_, _ = fmt.Fprintf(rsp, "id: %d\n", evt.Cursor)
+		}
+		_, _ = fmt.Fprintf(rsp, "event: %s\ndata: %s\n\n", evt.Type, data)
+		flusher.Flush()
+		return true
+	}
+
+	sub := newPushSubscriber(apps)
+	h.pushHub.subscribe(sub)
+	defer h.pushHub.unsubscribe(sub)
+
+	for _, evt := range h.snapshotFor(apps) {
+		writeSSE(evt)
+	}
+	cursor := parseResumeCursor(req)
+	for _, app := range apps {
+		for _, evt := range h.pushHub.since(formatReadName(strings.TrimSpace(app)), cursor) {
+			writeSSE(evt)
+		}
+	}
+
+	ticker := time.NewTicker(pushHeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case evt, ok := <-sub.queue:
+			if !ok {
+				return
+			}
+			writeSSE(evt)
+		case <-ticker.C:
+			writeSSE(&pushEvent{Type: "heartbeat"})
+		case <-req.Request.Context().Done():
+			return
+		}
+	}
+}
+
+// registerPushRoutes wires the WebSocket/SSE watch endpoints onto ws. It is invoked from
+// RegisterEurekaExtensionRoutes, not called directly.
+func (h *EurekaServer) registerPushRoutes(ws *restful.WebService) {
+	ws.Route(ws.GET("/v1/apps/{appName}/watch").To(h.HandleWatch))
+	ws.Route(ws.GET("/v1/apps/{appName}/events").To(h.HandleEvents))
+}
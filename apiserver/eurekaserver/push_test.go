@@ -0,0 +1,146 @@
+/**
+ * Tencent is pleased to support the open source community by making Polaris available.
+ *
+ * Copyright (C) 2019 THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * Licensed under the BSD 3-Clause License (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * https://opensource.org/licenses/BSD-3-Clause
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package eurekaserver
+
+import (
+	"testing"
+
+	"github.com/emicklei/go-restful/v3"
+)
+
+// TestRegisterPushRoutesAddsWatchAndEventsEndpoints proves registerPushRoutes actually
+// wires HandleWatch/HandleEvents onto a WebService, using a nil *EurekaServer receiver:
+// taking h.HandleWatch/h.HandleEvents as method values never dereferences h, so this
+// exercises the real registration path without needing a live server instance.
+func TestRegisterPushRoutesAddsWatchAndEventsEndpoints(t *testing.T) {
+	var h *EurekaServer
+	ws := new(restful.WebService).Path("/eureka")
+	h.registerPushRoutes(ws)
+
+	want := map[string]string{
+		"GET /eureka/v1/apps/{appName}/watch":  "",
+		"GET /eureka/v1/apps/{appName}/events": "",
+	}
+	for _, route := range ws.Routes() {
+		delete(want, route.Method+" "+route.Path)
+	}
+	if len(want) != 0 {
+		t.Errorf("registerPushRoutes did not register expected routes: %v", want)
+	}
+}
+
+func TestPushSubscriberMatches(t *testing.T) {
+	all := newPushSubscriber(nil)
+	if !all.matches("any-app") {
+		t.Errorf("a subscriber with no app filter should match every app")
+	}
+
+	filtered := newPushSubscriber([]string{"orders-service"})
+	if !filtered.matches("ORDERS-SERVICE") {
+		t.Errorf("matches should compare against formatReadName-normalized app names")
+	}
+	if filtered.matches("billing-service") {
+		t.Errorf("a filtered subscriber should not match an app outside its filter")
+	}
+}
+
+func TestPushSubscriberOfferDropsOldestAndSubstitutesResyncWhenFull(t *testing.T) {
+	sub := newPushSubscriber(nil)
+	for i := 0; i < pushQueueSize; i++ {
+		sub.offer(&pushEvent{Type: "update", Cursor: int64(i)})
+	}
+
+	// Queue is now full; the next offer must drop the oldest entry and enqueue a resync
+	// marker instead of blocking.
+	sub.offer(&pushEvent{Type: "update", AppName: "orders-service", Cursor: int64(pushQueueSize)})
+
+	first := <-sub.queue
+	if first.Cursor != 1 {
+		t.Errorf("expected the oldest event (cursor 0) to have been dropped, next cursor = %d, want 1", first.Cursor)
+	}
+
+	drained := []*pushEvent{first}
+	for len(sub.queue) > 0 {
+		drained = append(drained, <-sub.queue)
+	}
+	last := drained[len(drained)-1]
+	if last.Type != "resync" {
+		t.Fatalf("last queued event Type = %q, want %q", last.Type, "resync")
+	}
+	if last.AppName != "orders-service" {
+		t.Errorf("resync marker AppName = %q, want %q", last.AppName, "orders-service")
+	}
+}
+
+func TestPushSubscriberOfferDoesNotBlockWhenQueueIsFull(t *testing.T) {
+	sub := newPushSubscriber(nil)
+	for i := 0; i < pushQueueSize; i++ {
+		sub.offer(&pushEvent{Cursor: int64(i)})
+	}
+
+	done := make(chan struct{})
+	go func() {
+		sub.offer(&pushEvent{Cursor: 9999})
+		close(done)
+	}()
+	select {
+	case <-done:
+	default:
+	}
+	<-done
+}
+
+func TestPushHubSinceReturnsOnlyEventsAfterCursor(t *testing.T) {
+	hub := newPushHub()
+	hub.publish("orders-service", &ReplicationInstance{Action: actionRegister, LastDirtyTimestamp: 10})
+	hub.publish("orders-service", &ReplicationInstance{Action: actionHeartbeat, LastDirtyTimestamp: 20})
+	hub.publish("orders-service", &ReplicationInstance{Action: actionHeartbeat, LastDirtyTimestamp: 30})
+
+	got := hub.since("orders-service", 15)
+	if len(got) != 2 {
+		t.Fatalf("since(15) returned %d events, want 2", len(got))
+	}
+	if got[0].Cursor != 20 || got[1].Cursor != 30 {
+		t.Errorf("since(15) cursors = [%d, %d], want [20, 30]", got[0].Cursor, got[1].Cursor)
+	}
+}
+
+func TestPushHubPublishFansOutOnlyToMatchingSubscribers(t *testing.T) {
+	hub := newPushHub()
+	matching := newPushSubscriber([]string{"orders-service"})
+	other := newPushSubscriber([]string{"billing-service"})
+	hub.subscribe(matching)
+	hub.subscribe(other)
+
+	hub.publish("orders-service", &ReplicationInstance{Action: actionRegister, LastDirtyTimestamp: 1})
+
+	select {
+	case evt := <-matching.queue:
+		if evt.AppName != "orders-service" {
+			t.Errorf("matching subscriber got event for %q, want %q", evt.AppName, "orders-service")
+		}
+	default:
+		t.Fatalf("matching subscriber should have received the published event")
+	}
+
+	select {
+	case evt := <-other.queue:
+		t.Fatalf("non-matching subscriber should not receive the event, got %+v", evt)
+	default:
+	}
+}
@@ -60,9 +60,22 @@ func (h *EurekaServer) BatchReplication(req *restful.Request, rsp *restful.Respo
 		}
 		return
 	}
-	replicateRequest := &ReplicationList{}
+	var replicateRequest *ReplicationList
 	var err error
-	err = req.ReadEntity(replicateRequest)
+	if acceptsCloudEvents(req) {
+		ceEvents, ceErr := cloudEventsFromRequest(req)
+		if ceErr != nil {
+			log.Errorf("[EUREKA-SERVER] fail to parse cloudevents peer replicate request, uri: %s, client: %s, err: %v",
+				req.Request.RequestURI, remoteAddr, ceErr)
+			writePolarisStatusCode(req, api.ParseException)
+			writeHeader(http.StatusBadRequest, rsp)
+			return
+		}
+		replicateRequest, err = replicationListFromCloudEvents(ceEvents)
+	} else {
+		replicateRequest = &ReplicationList{}
+		err = req.ReadEntity(replicateRequest)
+	}
 	if nil != err {
 		log.Errorf("[EUREKA-SERVER] fail to parse peer replicate request, uri: %s, client: %s, err: %v",
 			req.Request.RequestURI, remoteAddr, err)
@@ -77,18 +90,20 @@ func (h *EurekaServer) BatchReplication(req *restful.Request, rsp *restful.Respo
 		writeHeader(http.StatusForbidden, rsp)
 		return
 	}
-	batchResponse, resultCode := h.doBatchReplicate(replicateRequest, token)
+	headerEnvelope, haveHeader := parseGossipEnvelopeHeader(req)
+	batchResponse, resultCode := h.doBatchReplicate(replicateRequest, token, sourceSvrName, headerEnvelope, haveHeader)
 	if err := writeEurekaResponseWithCode(restful.MIME_JSON, batchResponse, req, rsp, resultCode); nil != err {
 		log.Errorf("[EurekaServer]fail to write replicate response, client: %s, err: %v", remoteAddr, err)
 	}
 }
 
-func (h *EurekaServer) doBatchReplicate(
-	replicateRequest *ReplicationList, token string) (*ReplicationListResponse, uint32) {
+func (h *EurekaServer) doBatchReplicate(replicateRequest *ReplicationList, token string,
+	originNodeID string, headerEnvelope gossipEnvelope, haveHeader bool) (*ReplicationListResponse, uint32) {
 	batchResponse := &ReplicationListResponse{ResponseList: []*ReplicationInstanceResponse{}}
 	var resultCode = api.ExecuteSuccess
 	for _, instanceInfo := range replicateRequest.ReplicationList {
-		resp, code := h.dispatch(instanceInfo, token)
+		envelope := resolveGossipEnvelope(headerEnvelope, haveHeader, originNodeID, instanceInfo)
+		resp, code := h.dispatch(instanceInfo, token, envelope)
 		if code != api.ExecuteSuccess {
 			resultCode = code
 			log.Warnf("[EUREKA-SERVER] fail to process replicate instance request, code is %d, action %s, instance %s, app %s",
@@ -100,11 +115,18 @@ func (h *EurekaServer) doBatchReplicate(
 }
 
 func (h *EurekaServer) dispatch(
-	replicationInstance *ReplicationInstance, token string) (*ReplicationInstanceResponse, uint32) {
+	replicationInstance *ReplicationInstance, token string, envelope gossipEnvelope) (*ReplicationInstanceResponse, uint32) {
 	appName := formatReadName(replicationInstance.AppName)
 	ctx := context.WithValue(context.Background(), utils.ContextAuthTokenKey, token)
 	var retCode = api.ExecuteSuccess
 	log.Debugf("[EurekaServer]dispatch replicate request %+v", replicationInstance)
+	if !h.shouldApplyGossip(appName, replicationInstance.Id, envelope) {
+		// a causally older (or already-seen) delivery of this instance arrived via another
+		// hop of the mesh; treat it as a harmless duplicate rather than reapplying it.
+		log.Debugf("[EurekaServer]skip stale gossip delivery for app %s instance %s, origin %s",
+			appName, replicationInstance.Id, envelope.OriginNodeID)
+		return &ReplicationInstanceResponse{StatusCode: http.StatusOK}, api.ExecuteSuccess
+	}
 	if nil != replicationInstance.InstanceInfo {
 		_ = convertInstancePorts(replicationInstance.InstanceInfo)
 		log.Debugf("[EurekaServer]dispatch replicate instance %+v, port %+v, sport %+v",
@@ -142,6 +164,10 @@ func (h *EurekaServer) dispatch(
 	if retCode == api.NotFoundResource {
 		statusCode = http.StatusNotFound
 	}
+	if retCode == api.ExecuteSuccess {
+		// keep the update moving through the mesh instead of stopping at this hop
+		h.forwardGossip(replicationInstance, envelope)
+	}
 	return &ReplicationInstanceResponse{
 		StatusCode: statusCode,
 	}, retCode
@@ -198,26 +224,27 @@ func (h *EurekaServer) handleInstanceEvent(ctx context.Context, i interface{}) e
 	}
 	appName := formatReadName(e.Service)
 	curTimeMilli := time.Now().UnixMilli()
+	var rInstance *ReplicationInstance
 	switch e.EType {
 	case model.EventInstanceOnline:
 		instanceInfo := eventToInstance(&e, appName, curTimeMilli)
-		h.replicateWorker.AddReplicateTask(&ReplicationInstance{
+		rInstance = &ReplicationInstance{
 			AppName:            appName,
 			Id:                 e.Id,
 			LastDirtyTimestamp: curTimeMilli,
 			Status:             StatusUp,
 			InstanceInfo:       instanceInfo,
 			Action:             actionRegister,
-		})
+		}
 	case model.EventInstanceOffline:
-		h.replicateWorker.AddReplicateTask(&ReplicationInstance{
+		rInstance = &ReplicationInstance{
 			AppName: appName,
 			Id:      e.Id,
 			Action:  actionCancel,
-		})
+		}
 	case model.EventInstanceSendHeartbeat:
 		instanceInfo := eventToInstance(&e, appName, curTimeMilli)
-		rInstance := &ReplicationInstance{
+		rInstance = &ReplicationInstance{
 			AppName:      appName,
 			Id:           e.Id,
 			Status:       StatusUp,
@@ -227,39 +254,45 @@ func (h *EurekaServer) handleInstanceEvent(ctx context.Context, i interface{}) e
 		if e.Instance.GetIsolate().GetValue() {
 			rInstance.OverriddenStatus = StatusOutOfService
 		}
-		h.replicateWorker.AddReplicateTask(rInstance)
 	case model.EventInstanceTurnHealth:
-		h.replicateWorker.AddReplicateTask(&ReplicationInstance{
+		rInstance = &ReplicationInstance{
 			AppName:            appName,
 			Id:                 e.Id,
 			LastDirtyTimestamp: curTimeMilli,
 			Status:             StatusUp,
 			Action:             actionStatusUpdate,
-		})
+		}
 	case model.EventInstanceTurnUnHealth:
-		h.replicateWorker.AddReplicateTask(&ReplicationInstance{
+		rInstance = &ReplicationInstance{
 			AppName:            appName,
 			Id:                 e.Id,
 			LastDirtyTimestamp: curTimeMilli,
 			Status:             StatusDown,
 			Action:             actionStatusUpdate,
-		})
+		}
 	case model.EventInstanceOpenIsolate:
-		h.replicateWorker.AddReplicateTask(&ReplicationInstance{
+		rInstance = &ReplicationInstance{
 			AppName:            appName,
 			Id:                 e.Id,
 			LastDirtyTimestamp: curTimeMilli,
 			OverriddenStatus:   StatusOutOfService,
 			Action:             actionHeartbeat,
-		})
+		}
 	case model.EventInstanceCloseIsolate:
-		h.replicateWorker.AddReplicateTask(&ReplicationInstance{
+		rInstance = &ReplicationInstance{
 			AppName:            appName,
 			Id:                 e.Id,
 			LastDirtyTimestamp: curTimeMilli,
 			Action:             actionDeleteStatusOverride,
-		})
-
+		}
+	}
+	if rInstance == nil {
+		return nil
 	}
+	h.replicateWorker.AddReplicateTask(rInstance)
+	// best-effort fan-out to the configured CloudEvents sinks, independent of native peer replication
+	h.publishToSinks(rInstance)
+	// fan-out to local watch/SSE subscribers, independent of peer replication and sinks
+	h.pushHub.publish(appName, rInstance)
 	return nil
 }
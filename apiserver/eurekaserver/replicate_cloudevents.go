@@ -0,0 +1,263 @@
+/**
+ * Tencent is pleased to support the open source community by making Polaris available.
+ *
+ * Copyright (C) 2019 THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * Licensed under the BSD 3-Clause License (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * https://opensource.org/licenses/BSD-3-Clause
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package eurekaserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/cloudevents/sdk-go/v2/event"
+	"github.com/emicklei/go-restful/v3"
+)
+
+const (
+	ceSourcePrefix   = "/polaris/eureka"
+	ceTypePrefix     = "com.polarismesh.eureka.instance"
+	ceContentTypeCE  = "application/cloudevents+json"
+	ceContentTypeBCE = "application/cloudevents-batch+json"
+)
+
+// actionToEventType maps a replication action to its CloudEvents `type` suffix, e.g.
+// actionRegister -> com.polarismesh.eureka.instance.register.
+var actionToEventType = map[string]string{
+	actionRegister:             "register",
+	actionHeartbeat:            "heartbeat",
+	actionCancel:               "cancel",
+	actionStatusUpdate:         "statusUpdate",
+	actionDeleteStatusOverride: "deleteStatusOverride",
+}
+
+// replicateSink is a destination that replication events are additionally published to,
+// alongside the native Eureka peer replication channel.
+type replicateSink struct {
+	// URL is the sink address, e.g. http://host:port/path, kafka://broker/topic or mqtt://broker/topic.
+	URL string
+	// client delivers a built CloudEvent to URL; only the HTTP transport is wired in-process,
+	// for kafka/mqtt sinks it is nil and publishToSinks skips the sink.
+	client cloudevents.Client
+}
+
+// newReplicateSink builds a sink bound to an HTTP(S) CloudEvents target. Non-HTTP schemes
+// (kafka, mqtt) are accepted here for config symmetry but get no client, since those
+// protocol bindings live outside this package's dependencies.
+func newReplicateSink(url string) (*replicateSink, error) {
+	sink := &replicateSink{URL: url}
+	if strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://") {
+		c, err := cloudevents.NewClientHTTP(cloudevents.WithTarget(url))
+		if err != nil {
+			return nil, fmt.Errorf("fail to build cloudevents http client for sink %s: %w", url, err)
+		}
+		sink.client = c
+	}
+	return sink, nil
+}
+
+// instanceEventData is the JSON payload carried by a CloudEvents-wrapped instance change.
+// Status and OverriddenStatus travel alongside the instance body because actionStatusUpdate
+// (and the isolate-driven OverriddenStatus override folded into heartbeat/register events)
+// needs them to apply the right status; neither is recoverable from the event's type or
+// subject the way Action/AppName/Id are.
+type instanceEventData struct {
+	Instance         *InstanceInfo `json:"instance,omitempty"`
+	Status           string        `json:"status,omitempty"`
+	OverriddenStatus string        `json:"overriddenStatus,omitempty"`
+}
+
+// buildInstanceEvent converts a ReplicationInstance into a CloudEvents v1.0 envelope.
+// The event id is derived from AppName+Id+Action+LastDirtyTimestamp so that redeliveries
+// of the same logical change (e.g. via the retry queue) correlate to the same event id.
+func buildInstanceEvent(namespace string, instance *ReplicationInstance) (event.Event, error) {
+	e := cloudevents.NewEvent()
+	typeSuffix, ok := actionToEventType[instance.Action]
+	if !ok {
+		typeSuffix = strings.ToLower(instance.Action)
+	}
+	e.SetID(fmt.Sprintf("%s-%s-%s-%d", instance.AppName, instance.Id, instance.Action, instance.LastDirtyTimestamp))
+	e.SetType(fmt.Sprintf("%s.%s", ceTypePrefix, typeSuffix))
+	e.SetSource(fmt.Sprintf("%s/%s", ceSourcePrefix, namespace))
+	e.SetSubject(fmt.Sprintf("%s/%s", instance.AppName, instance.Id))
+	data := instanceEventData{
+		Instance:         instance.InstanceInfo,
+		Status:           instance.Status,
+		OverriddenStatus: instance.OverriddenStatus,
+	}
+	if err := e.SetData(cloudevents.ApplicationJSON, data); err != nil {
+		return event.Event{}, fmt.Errorf("fail to set cloudevent data for instance %s: %w", instance.Id, err)
+	}
+	return e, nil
+}
+
+// publishToSinks emits instance as a CloudEvent to every configured replicateSink. Delivery
+// failures are logged rather than surfaced to the caller: sinks are an additional, best
+// effort broadcast channel and must not block or fail native Eureka peer replication.
+func (h *EurekaServer) publishToSinks(instance *ReplicationInstance) {
+	if len(h.replicateSinks) == 0 {
+		return
+	}
+	e, err := buildInstanceEvent(h.namespace, instance)
+	if err != nil {
+		log.Errorf("[EUREKA-SERVER] fail to build cloudevent for instance %s, err: %v", instance.Id, err)
+		return
+	}
+	for _, sink := range h.replicateSinks {
+		if sink.client == nil {
+			log.Warnf("[EUREKA-SERVER] skip publish to sink %s, no client bound for its transport", sink.URL)
+			continue
+		}
+		ctx := cloudevents.ContextWithTarget(context.Background(), sink.URL)
+		if result := sink.client.Send(ctx, e); cloudevents.IsUndelivered(result) {
+			log.Errorf("[EUREKA-SERVER] fail to publish instance %s to sink %s, err: %v", instance.Id, sink.URL, result)
+		}
+	}
+}
+
+// acceptsCloudEvents reports whether req negotiated any of the three CloudEvents HTTP
+// transport modes: a structured single event, a structured batch (used for
+// ReplicationList-shaped bodies), or binary mode (ce-specversion and friends as headers,
+// the raw body as data). cloudEventsFromRequest mirrors this same dispatch.
+func acceptsCloudEvents(req *restful.Request) bool {
+	ct := req.HeaderParameter(restful.HEADER_ContentType)
+	return strings.HasPrefix(ct, ceContentTypeCE) || strings.HasPrefix(ct, ceContentTypeBCE) ||
+		req.HeaderParameter("ce-specversion") != ""
+}
+
+// cloudEventsFromRequest decodes req's body into one or more event.Event values,
+// dispatching on the same three transport modes acceptsCloudEvents recognizes: a batch
+// array of structured events, a single structured event object, or binary mode (metadata
+// in ce-* headers, raw data as the body).
+func cloudEventsFromRequest(req *restful.Request) ([]event.Event, error) {
+	ct := req.HeaderParameter(restful.HEADER_ContentType)
+	switch {
+	case strings.HasPrefix(ct, ceContentTypeBCE):
+		return decodeBatchCloudEvents(req)
+	case strings.HasPrefix(ct, ceContentTypeCE):
+		e, err := decodeStructuredCloudEvent(req)
+		if err != nil {
+			return nil, err
+		}
+		return []event.Event{e}, nil
+	default:
+		e, err := decodeBinaryCloudEvent(req)
+		if err != nil {
+			return nil, err
+		}
+		return []event.Event{e}, nil
+	}
+}
+
+// decodeBatchCloudEvents decodes a CloudEvents-batch request body (one JSON array of
+// structured-mode events) into individual events.
+func decodeBatchCloudEvents(req *restful.Request) ([]event.Event, error) {
+	var raw []json.RawMessage
+	if err := req.ReadEntity(&raw); err != nil {
+		return nil, fmt.Errorf("fail to read cloudevents batch body: %w", err)
+	}
+	events := make([]event.Event, 0, len(raw))
+	for _, msg := range raw {
+		e := cloudevents.NewEvent()
+		if err := e.UnmarshalJSON(msg); err != nil {
+			return nil, fmt.Errorf("fail to unmarshal cloudevent: %w", err)
+		}
+		events = append(events, e)
+	}
+	return events, nil
+}
+
+// decodeStructuredCloudEvent decodes a single application/cloudevents+json request body
+// (one JSON object, not wrapped in an array) into an event.Event.
+func decodeStructuredCloudEvent(req *restful.Request) (event.Event, error) {
+	body, err := io.ReadAll(req.Request.Body)
+	if err != nil {
+		return event.Event{}, fmt.Errorf("fail to read cloudevent body: %w", err)
+	}
+	e := cloudevents.NewEvent()
+	if err := e.UnmarshalJSON(body); err != nil {
+		return event.Event{}, fmt.Errorf("fail to unmarshal cloudevent: %w", err)
+	}
+	return e, nil
+}
+
+// decodeBinaryCloudEvent reconstructs an event.Event from the CloudEvents HTTP protocol
+// binding's binary mode: envelope metadata travels in ce-id/ce-type/ce-source/ce-subject
+// headers and the raw request body is the event's data, with Content-Type as its
+// datacontenttype.
+func decodeBinaryCloudEvent(req *restful.Request) (event.Event, error) {
+	body, err := io.ReadAll(req.Request.Body)
+	if err != nil {
+		return event.Event{}, fmt.Errorf("fail to read cloudevent body: %w", err)
+	}
+	e := cloudevents.NewEvent()
+	e.SetID(req.HeaderParameter("ce-id"))
+	e.SetType(req.HeaderParameter("ce-type"))
+	e.SetSource(req.HeaderParameter("ce-source"))
+	if subject := req.HeaderParameter("ce-subject"); subject != "" {
+		e.SetSubject(subject)
+	}
+	dataContentType := req.HeaderParameter(restful.HEADER_ContentType)
+	if dataContentType == "" {
+		dataContentType = cloudevents.ApplicationJSON
+	}
+	if err := e.SetData(dataContentType, body); err != nil {
+		return event.Event{}, fmt.Errorf("fail to set cloudevent data: %w", err)
+	}
+	return e, nil
+}
+
+// replicationListFromCloudEvents decodes a batch of CloudEvents-wrapped instance events
+// back into the native ReplicationList shape so BatchReplication can dispatch them through
+// the same registerInstances/renew/deregisterInstance/updateStatus path as native requests.
+func replicationListFromCloudEvents(events []event.Event) (*ReplicationList, error) {
+	list := &ReplicationList{}
+	for _, e := range events {
+		parts := strings.Split(e.Type(), ".")
+		action := ""
+		if len(parts) > 0 {
+			suffix := parts[len(parts)-1]
+			for a, s := range actionToEventType {
+				if s == suffix {
+					action = a
+					break
+				}
+			}
+		}
+		if action == "" {
+			return nil, fmt.Errorf("unrecognized cloudevent type %s", e.Type())
+		}
+		var data instanceEventData
+		if err := e.DataAs(&data); err != nil {
+			return nil, fmt.Errorf("fail to decode cloudevent data for %s: %w", e.ID(), err)
+		}
+		subject := strings.SplitN(e.Subject(), "/", 2)
+		instance := &ReplicationInstance{
+			Action:           action,
+			InstanceInfo:     data.Instance,
+			Status:           data.Status,
+			OverriddenStatus: data.OverriddenStatus,
+		}
+		if len(subject) == 2 {
+			instance.AppName = subject[0]
+			instance.Id = subject[1]
+		}
+		list.ReplicationList = append(list.ReplicationList, instance)
+	}
+	return list, nil
+}
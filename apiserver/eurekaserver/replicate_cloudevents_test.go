@@ -0,0 +1,157 @@
+/**
+ * Tencent is pleased to support the open source community by making Polaris available.
+ *
+ * Copyright (C) 2019 THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * Licensed under the BSD 3-Clause License (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * https://opensource.org/licenses/BSD-3-Clause
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package eurekaserver
+
+import (
+	"testing"
+
+	"github.com/cloudevents/sdk-go/v2/event"
+)
+
+func TestBuildInstanceEventRoundTripsThroughReplicationListFromCloudEvents(t *testing.T) {
+	original := &ReplicationInstance{
+		AppName:            "orders-service",
+		Id:                 "inst-42",
+		Action:             actionRegister,
+		LastDirtyTimestamp: 1234567890,
+		InstanceInfo:       &InstanceInfo{InstanceId: "inst-42"},
+	}
+
+	e, err := buildInstanceEvent("default", original)
+	if err != nil {
+		t.Fatalf("buildInstanceEvent() error = %v", err)
+	}
+	wantType := "com.polarismesh.eureka.instance.register"
+	if e.Type() != wantType {
+		t.Errorf("Type() = %q, want %q", e.Type(), wantType)
+	}
+	wantSource := "/polaris/eureka/default"
+	if e.Source() != wantSource {
+		t.Errorf("Source() = %q, want %q", e.Source(), wantSource)
+	}
+	wantSubject := "orders-service/inst-42"
+	if e.Subject() != wantSubject {
+		t.Errorf("Subject() = %q, want %q", e.Subject(), wantSubject)
+	}
+
+	list, err := replicationListFromCloudEvents([]event.Event{e})
+	if err != nil {
+		t.Fatalf("replicationListFromCloudEvents() error = %v", err)
+	}
+	if len(list.ReplicationList) != 1 {
+		t.Fatalf("got %d replication instances, want 1", len(list.ReplicationList))
+	}
+	got := list.ReplicationList[0]
+	if got.AppName != original.AppName {
+		t.Errorf("AppName = %q, want %q", got.AppName, original.AppName)
+	}
+	if got.Id != original.Id {
+		t.Errorf("Id = %q, want %q", got.Id, original.Id)
+	}
+	if got.Action != original.Action {
+		t.Errorf("Action = %q, want %q", got.Action, original.Action)
+	}
+	if got.InstanceInfo == nil || got.InstanceInfo.InstanceId != original.InstanceInfo.InstanceId {
+		t.Errorf("InstanceInfo = %+v, want InstanceId %q", got.InstanceInfo, original.InstanceInfo.InstanceId)
+	}
+}
+
+func TestBuildInstanceEventRoundTripsStatusForStatusUpdate(t *testing.T) {
+	original := &ReplicationInstance{
+		AppName:            "orders-service",
+		Id:                 "inst-7",
+		Action:             actionStatusUpdate,
+		LastDirtyTimestamp: 555,
+		Status:             StatusDown,
+	}
+
+	e, err := buildInstanceEvent("default", original)
+	if err != nil {
+		t.Fatalf("buildInstanceEvent() error = %v", err)
+	}
+
+	list, err := replicationListFromCloudEvents([]event.Event{e})
+	if err != nil {
+		t.Fatalf("replicationListFromCloudEvents() error = %v", err)
+	}
+	if len(list.ReplicationList) != 1 {
+		t.Fatalf("got %d replication instances, want 1", len(list.ReplicationList))
+	}
+	got := list.ReplicationList[0]
+	if got.Status != StatusDown {
+		t.Errorf("Status = %q, want %q — a CloudEvents-decoded status update would apply the "+
+			"wrong (empty) status instead of flipping instance health", got.Status, StatusDown)
+	}
+}
+
+func TestBuildInstanceEventRoundTripsOverriddenStatus(t *testing.T) {
+	original := &ReplicationInstance{
+		AppName:            "orders-service",
+		Id:                 "inst-8",
+		Action:             actionHeartbeat,
+		LastDirtyTimestamp: 777,
+		OverriddenStatus:   StatusOutOfService,
+	}
+
+	e, err := buildInstanceEvent("default", original)
+	if err != nil {
+		t.Fatalf("buildInstanceEvent() error = %v", err)
+	}
+
+	list, err := replicationListFromCloudEvents([]event.Event{e})
+	if err != nil {
+		t.Fatalf("replicationListFromCloudEvents() error = %v", err)
+	}
+	got := list.ReplicationList[0]
+	if got.OverriddenStatus != StatusOutOfService {
+		t.Errorf("OverriddenStatus = %q, want %q", got.OverriddenStatus, StatusOutOfService)
+	}
+}
+
+func TestBuildInstanceEventIDIsStableAcrossRedeliveries(t *testing.T) {
+	instance := &ReplicationInstance{
+		AppName:            "orders-service",
+		Id:                 "inst-42",
+		Action:             actionHeartbeat,
+		LastDirtyTimestamp: 111,
+	}
+	first, err := buildInstanceEvent("default", instance)
+	if err != nil {
+		t.Fatalf("buildInstanceEvent() error = %v", err)
+	}
+	second, err := buildInstanceEvent("default", instance)
+	if err != nil {
+		t.Fatalf("buildInstanceEvent() error = %v", err)
+	}
+	if first.ID() != second.ID() {
+		t.Errorf("rebuilding the event for the same instance should produce the same id, got %q and %q",
+			first.ID(), second.ID())
+	}
+}
+
+func TestReplicationListFromCloudEventsRejectsUnknownType(t *testing.T) {
+	e := event.New()
+	e.SetID("1")
+	e.SetType("com.polarismesh.eureka.instance.unknown")
+	e.SetSource("/polaris/eureka/default")
+	e.SetSubject("app/inst")
+
+	if _, err := replicationListFromCloudEvents([]event.Event{e}); err == nil {
+		t.Errorf("expected an error for an unrecognized cloudevent type, got nil")
+	}
+}
@@ -0,0 +1,375 @@
+/**
+ * Tencent is pleased to support the open source community by making Polaris available.
+ *
+ * Copyright (C) 2019 THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * Licensed under the BSD 3-Clause License (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * https://opensource.org/licenses/BSD-3-Clause
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package eurekaserver
+
+import (
+	"bufio"
+	"container/list"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/emicklei/go-restful/v3"
+
+	api "github.com/polarismesh/polaris/common/api/v1"
+)
+
+const (
+	// defaultRetryMaxAttempts is the number of delivery attempts before a task is
+	// moved off the retry queue and into the dead-letter store.
+	defaultRetryMaxAttempts = 10
+	// defaultRetryInitialInterval is the first backoff delay applied after a failed attempt.
+	defaultRetryInitialInterval = 200 * time.Millisecond
+	// defaultRetryMaxInterval caps the exponential backoff delay.
+	defaultRetryMaxInterval = 30 * time.Second
+	// defaultRetryMaxElapsedTime bounds the total time a task may spend retrying.
+	defaultRetryMaxElapsedTime = 15 * time.Minute
+	// defaultDeadLetterCapacity is the size of the in-memory dead-letter ring.
+	defaultDeadLetterCapacity = 2000
+)
+
+// isTerminalReplicateCode reports whether code already represents a logical success,
+// mirroring the special-casing dispatch performs for register/cancel idempotency.
+func isTerminalReplicateCode(action string, code uint32) bool {
+	if code == api.ExecuteSuccess {
+		return true
+	}
+	switch action {
+	case actionCancel:
+		return code == api.NotFoundResource
+	case actionRegister:
+		return code == api.ExistedResource
+	}
+	return false
+}
+
+// retryTask wraps a ReplicationInstance bound for a specific peer with the bookkeeping
+// needed to drive exponential backoff and eventual dead-lettering. Envelope carries the
+// gossip routing metadata (origin, vector clock, hop count) the send originally went out
+// with, so a redelivery from forwardGossip doesn't lose it and reappear at the next peer
+// as a fresh hop-0 delivery with a fallback-derived clock.
+type retryTask struct {
+	Peer        string               `json:"peer"`
+	Instance    *ReplicationInstance `json:"instance"`
+	Envelope    gossipEnvelope       `json:"envelope,omitempty"`
+	Attempts    int                  `json:"attempts"`
+	FirstSeen   time.Time            `json:"firstSeen"`
+	NextAttempt time.Time            `json:"nextAttempt"`
+	LastError   string               `json:"lastError,omitempty"`
+
+	backOff backoff.BackOff
+}
+
+func newRetryTask(peer string, instance *ReplicationInstance, envelope gossipEnvelope) *retryTask {
+	bo := backoff.NewExponentialBackOff()
+	bo.InitialInterval = defaultRetryInitialInterval
+	bo.MaxInterval = defaultRetryMaxInterval
+	bo.MaxElapsedTime = defaultRetryMaxElapsedTime
+	return &retryTask{
+		Peer:        peer,
+		Instance:    instance,
+		Envelope:    envelope,
+		FirstSeen:   time.Now(),
+		NextAttempt: time.Now(),
+		backOff:     bo,
+	}
+}
+
+// scheduleNext advances the task's NextAttempt using the wrapped backoff policy and
+// reports whether the task has exhausted its retry budget and should be dead-lettered.
+func (t *retryTask) scheduleNext(cause error) bool {
+	t.Attempts++
+	if cause != nil {
+		t.LastError = cause.Error()
+	}
+	next := t.backOff.NextBackOff()
+	if next == backoff.Stop || t.Attempts >= defaultRetryMaxAttempts {
+		return true
+	}
+	t.NextAttempt = time.Now().Add(next)
+	return false
+}
+
+// replicateRetryQueue buffers failed replication tasks and redelivers them to the
+// configured sender once their backoff interval elapses, dead-lettering tasks that
+// never succeed within defaultRetryMaxAttempts.
+type replicateRetryQueue struct {
+	mu      sync.Mutex
+	pending *list.List
+	dlq     *deadLetterQueue
+	sender  func(peer string, instance *ReplicationInstance, envelope gossipEnvelope) (uint32, error)
+
+	ticker *time.Ticker
+	stopCh chan struct{}
+}
+
+// newReplicateRetryQueue builds a retry queue that redelivers via sender and spills
+// exhausted tasks into dlqDir (file spooling is skipped when dlqDir is empty).
+func newReplicateRetryQueue(dlqDir string,
+	sender func(peer string, instance *ReplicationInstance, envelope gossipEnvelope) (uint32, error)) *replicateRetryQueue {
+	q := &replicateRetryQueue{
+		pending: list.New(),
+		dlq:     newDeadLetterQueue(dlqDir),
+		sender:  sender,
+		ticker:  time.NewTicker(time.Second),
+		stopCh:  make(chan struct{}),
+	}
+	go q.run()
+	return q
+}
+
+// Enqueue records a failed delivery for peer and schedules its first retry, preserving
+// envelope so a retried gossip re-forward carries the same routing metadata it was
+// originally sent with.
+func (q *replicateRetryQueue) Enqueue(peer string, instance *ReplicationInstance, envelope gossipEnvelope, cause error) {
+	task := newRetryTask(peer, instance, envelope)
+	if task.scheduleNext(cause) {
+		q.dlq.Add(task)
+		return
+	}
+	q.mu.Lock()
+	q.pending.PushBack(task)
+	q.mu.Unlock()
+}
+
+func (q *replicateRetryQueue) run() {
+	for {
+		select {
+		case <-q.stopCh:
+			return
+		case <-q.ticker.C:
+			q.drainDue()
+		}
+	}
+}
+
+func (q *replicateRetryQueue) drainDue() {
+	now := time.Now()
+	var due []*retryTask
+	q.mu.Lock()
+	for e := q.pending.Front(); e != nil; {
+		next := e.Next()
+		task := e.Value.(*retryTask)
+		if !task.NextAttempt.After(now) {
+			due = append(due, task)
+			q.pending.Remove(e)
+		}
+		e = next
+	}
+	q.mu.Unlock()
+
+	for _, task := range due {
+		code, err := q.sender(task.Peer, task.Instance, task.Envelope)
+		if err == nil && isTerminalReplicateCode(task.Instance.Action, code) {
+			continue
+		}
+		if err == nil {
+			err = fmt.Errorf("replicate to %s returned code %d", task.Peer, code)
+		}
+		if task.scheduleNext(err) {
+			q.dlq.Add(task)
+			continue
+		}
+		q.mu.Lock()
+		q.pending.PushBack(task)
+		q.mu.Unlock()
+	}
+}
+
+// Stop terminates the background redelivery loop.
+func (q *replicateRetryQueue) Stop() {
+	close(q.stopCh)
+	q.ticker.Stop()
+}
+
+// deadLetterQueue keeps the most recent exhausted retry tasks in memory, optionally
+// spooling each one to a JSON-lines file under dir so operators can inspect or replay
+// them after a restart.
+type deadLetterQueue struct {
+	mu       sync.Mutex
+	capacity int
+	items    *list.List
+	byID     map[string]*list.Element
+	dir      string
+}
+
+func newDeadLetterQueue(dir string) *deadLetterQueue {
+	if dir != "" {
+		_ = os.MkdirAll(dir, 0o755)
+	}
+	return &deadLetterQueue{
+		capacity: defaultDeadLetterCapacity,
+		items:    list.New(),
+		byID:     make(map[string]*list.Element),
+		dir:      dir,
+	}
+}
+
+func dlqTaskID(task *retryTask) string {
+	return fmt.Sprintf("%s/%s/%s/%d", task.Peer, task.Instance.AppName, task.Instance.Id, task.Instance.LastDirtyTimestamp)
+}
+
+// Add moves an exhausted retry task into the dead-letter store, evicting the oldest
+// entry once the in-memory ring reaches its configured capacity.
+func (q *deadLetterQueue) Add(task *retryTask) {
+	id := dlqTaskID(task)
+	log.Warnf("[EUREKA-SERVER] replication to peer %s exhausted retries for app %s instance %s, moved to dead-letter queue",
+		task.Peer, task.Instance.AppName, task.Instance.Id)
+
+	q.mu.Lock()
+	if q.items.Len() >= q.capacity {
+		oldest := q.items.Front()
+		if oldest != nil {
+			evicted := q.items.Remove(oldest).(*retryTask)
+			delete(q.byID, dlqTaskID(evicted))
+		}
+	}
+	q.byID[id] = q.items.PushBack(task)
+	q.mu.Unlock()
+
+	q.spool(id, task)
+}
+
+func (q *deadLetterQueue) spool(id string, task *retryTask) {
+	if q.dir == "" {
+		return
+	}
+	f, err := os.OpenFile(filepath.Join(q.dir, "replication-dlq.jsonl"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		log.Errorf("[EUREKA-SERVER] fail to open dlq spool file, dir %s, err: %v", q.dir, err)
+		return
+	}
+	defer func() { _ = f.Close() }()
+	w := bufio.NewWriter(f)
+	defer func() { _ = w.Flush() }()
+	entry := struct {
+		ID string `json:"id"`
+		*retryTask
+	}{ID: id, retryTask: task}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		log.Errorf("[EUREKA-SERVER] fail to marshal dlq entry %s, err: %v", id, err)
+		return
+	}
+	_, _ = w.Write(data)
+	_, _ = w.WriteString("\n")
+}
+
+// List returns a snapshot of every task currently held in the dead-letter queue.
+func (q *deadLetterQueue) List() []*retryTask {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	tasks := make([]*retryTask, 0, q.items.Len())
+	for e := q.items.Front(); e != nil; e = e.Next() {
+		tasks = append(tasks, e.Value.(*retryTask))
+	}
+	return tasks
+}
+
+// Remove drops id from the dead-letter queue, returning the task if it was present.
+func (q *deadLetterQueue) Remove(id string) *retryTask {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	e, ok := q.byID[id]
+	if !ok {
+		return nil
+	}
+	delete(q.byID, id)
+	return q.items.Remove(e).(*retryTask)
+}
+
+// Purge empties the dead-letter queue and returns the number of tasks dropped.
+func (q *deadLetterQueue) Purge() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	n := q.items.Len()
+	q.items.Init()
+	q.byID = make(map[string]*list.Element)
+	return n
+}
+
+// dlqEntryView is the JSON shape returned by the /eureka/v1/replication/dlq admin endpoint.
+type dlqEntryView struct {
+	ID         string    `json:"id"`
+	Peer       string    `json:"peer"`
+	AppName    string    `json:"appName"`
+	InstanceID string    `json:"instanceId"`
+	Action     string    `json:"action"`
+	Attempts   int       `json:"attempts"`
+	FirstSeen  time.Time `json:"firstSeen"`
+	LastError  string    `json:"lastError,omitempty"`
+}
+
+func toDLQView(task *retryTask) dlqEntryView {
+	return dlqEntryView{
+		ID:         dlqTaskID(task),
+		Peer:       task.Peer,
+		AppName:    task.Instance.AppName,
+		InstanceID: task.Instance.Id,
+		Action:     task.Instance.Action,
+		Attempts:   task.Attempts,
+		FirstSeen:  task.FirstSeen,
+		LastError:  task.LastError,
+	}
+}
+
+// HandleDLQList lists every task currently parked in the replication dead-letter queue.
+// GET /eureka/v1/replication/dlq
+func (h *EurekaServer) HandleDLQList(req *restful.Request, rsp *restful.Response) {
+	tasks := h.replicateWorker.retryQueue.dlq.List()
+	views := make([]dlqEntryView, 0, len(tasks))
+	for _, task := range tasks {
+		views = append(views, toDLQView(task))
+	}
+	_ = rsp.WriteAsJson(views)
+}
+
+// HandleDLQRetry replays a single dead-lettered task, re-enqueueing it on the retry queue
+// with a fresh retry budget; it is redelivered once its first backoff delay has elapsed
+// and is subject to the normal backoff/dead-letter lifecycle again.
+// POST /eureka/v1/replication/dlq/retry?id=<id>
+func (h *EurekaServer) HandleDLQRetry(req *restful.Request, rsp *restful.Response) {
+	id := req.QueryParameter("id")
+	task := h.replicateWorker.retryQueue.dlq.Remove(id)
+	if task == nil {
+		writeHeader(http.StatusNotFound, rsp)
+		return
+	}
+	h.replicateWorker.retryQueue.Enqueue(task.Peer, task.Instance, task.Envelope, nil)
+	writeHeader(http.StatusOK, rsp)
+}
+
+// HandleDLQPurge drops every task currently parked in the dead-letter queue.
+// DELETE /eureka/v1/replication/dlq
+func (h *EurekaServer) HandleDLQPurge(req *restful.Request, rsp *restful.Response) {
+	n := h.replicateWorker.retryQueue.dlq.Purge()
+	_ = rsp.WriteAsJson(map[string]int{"purged": n})
+}
+
+// registerReplicationAdminRoutes wires the replication dead-letter admin API onto ws. It
+// is invoked from RegisterEurekaExtensionRoutes, not called directly.
+func (h *EurekaServer) registerReplicationAdminRoutes(ws *restful.WebService) {
+	ws.Route(ws.GET("/v1/replication/dlq").To(h.HandleDLQList))
+	ws.Route(ws.POST("/v1/replication/dlq/retry").To(h.HandleDLQRetry))
+	ws.Route(ws.DELETE("/v1/replication/dlq").To(h.HandleDLQPurge))
+}
@@ -0,0 +1,164 @@
+/**
+ * Tencent is pleased to support the open source community by making Polaris available.
+ *
+ * Copyright (C) 2019 THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * Licensed under the BSD 3-Clause License (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * https://opensource.org/licenses/BSD-3-Clause
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package eurekaserver
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/emicklei/go-restful/v3"
+
+	api "github.com/polarismesh/polaris/common/api/v1"
+)
+
+// TestRegisterReplicationAdminRoutesAddsDLQEndpoints proves registerReplicationAdminRoutes
+// actually wires the DLQ admin handlers onto a WebService, using a nil *EurekaServer
+// receiver: taking h.HandleDLQList/HandleDLQRetry/HandleDLQPurge as method values never
+// dereferences h, so this exercises the real registration path without a live server.
+func TestRegisterReplicationAdminRoutesAddsDLQEndpoints(t *testing.T) {
+	var h *EurekaServer
+	ws := new(restful.WebService).Path("/eureka")
+	h.registerReplicationAdminRoutes(ws)
+
+	want := map[string]bool{
+		"GET /eureka/v1/replication/dlq":        false,
+		"POST /eureka/v1/replication/dlq/retry": false,
+		"DELETE /eureka/v1/replication/dlq":     false,
+	}
+	for _, route := range ws.Routes() {
+		key := route.Method + " " + route.Path
+		if _, ok := want[key]; ok {
+			want[key] = true
+		}
+	}
+	for route, found := range want {
+		if !found {
+			t.Errorf("registerReplicationAdminRoutes did not register expected route %q", route)
+		}
+	}
+}
+
+func TestIsTerminalReplicateCode(t *testing.T) {
+	cases := []struct {
+		name   string
+		action string
+		code   uint32
+		want   bool
+	}{
+		{"success is always terminal", actionHeartbeat, api.ExecuteSuccess, true},
+		{"cancel of missing instance is terminal", actionCancel, api.NotFoundResource, true},
+		{"register of existing instance is terminal", actionRegister, api.ExistedResource, true},
+		{"not-found on register is not terminal", actionRegister, api.NotFoundResource, false},
+		{"existed-resource on cancel is not terminal", actionCancel, api.ExistedResource, false},
+		{"generic failure is not terminal", actionHeartbeat, api.ExecuteException, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := isTerminalReplicateCode(c.action, c.code); got != c.want {
+				t.Errorf("isTerminalReplicateCode(%s, %d) = %v, want %v", c.action, c.code, got, c.want)
+			}
+		})
+	}
+}
+
+func TestRetryTaskScheduleNextExhaustsAfterMaxAttempts(t *testing.T) {
+	task := newRetryTask("peer1", &ReplicationInstance{AppName: "app", Id: "inst-1", Action: actionHeartbeat}, gossipEnvelope{})
+	cause := errors.New("peer unreachable")
+
+	var exhausted bool
+	for i := 0; i < defaultRetryMaxAttempts; i++ {
+		exhausted = task.scheduleNext(cause)
+		if exhausted {
+			break
+		}
+	}
+	if !exhausted {
+		t.Fatalf("expected task to be exhausted within %d attempts, got %d attempts", defaultRetryMaxAttempts, task.Attempts)
+	}
+	if task.Attempts > defaultRetryMaxAttempts {
+		t.Errorf("attempts = %d, want <= %d", task.Attempts, defaultRetryMaxAttempts)
+	}
+	if task.LastError != cause.Error() {
+		t.Errorf("LastError = %q, want %q", task.LastError, cause.Error())
+	}
+}
+
+func TestRetryTaskScheduleNextKeepsRetryingBeforeBudgetExhausted(t *testing.T) {
+	task := newRetryTask("peer1", &ReplicationInstance{AppName: "app", Id: "inst-1", Action: actionHeartbeat}, gossipEnvelope{})
+	if task.scheduleNext(errors.New("boom")) {
+		t.Fatalf("first failure should not exhaust the retry budget")
+	}
+	if task.Attempts != 1 {
+		t.Errorf("Attempts = %d, want 1", task.Attempts)
+	}
+	if !task.NextAttempt.After(task.FirstSeen) {
+		t.Errorf("NextAttempt should be scheduled after FirstSeen")
+	}
+}
+
+func TestDeadLetterQueueAddListRemovePurge(t *testing.T) {
+	dlq := newDeadLetterQueue("")
+	task := newRetryTask("peer1", &ReplicationInstance{AppName: "app", Id: "inst-1", Action: actionCancel}, gossipEnvelope{})
+	task.scheduleNext(errors.New("exhausted"))
+	dlq.Add(task)
+
+	list := dlq.List()
+	if len(list) != 1 {
+		t.Fatalf("List() returned %d entries, want 1", len(list))
+	}
+
+	id := dlqTaskID(task)
+	if got := dlq.Remove(id); got == nil {
+		t.Fatalf("Remove(%q) = nil, want the task", id)
+	}
+	if len(dlq.List()) != 0 {
+		t.Fatalf("expected dlq to be empty after Remove, got %d entries", len(dlq.List()))
+	}
+
+	dlq.Add(task)
+	dlq.Add(newRetryTask("peer2", &ReplicationInstance{AppName: "app", Id: "inst-2", Action: actionCancel}, gossipEnvelope{}))
+	if purged := dlq.Purge(); purged != 2 {
+		t.Errorf("Purge() = %d, want 2", purged)
+	}
+	if len(dlq.List()) != 0 {
+		t.Errorf("expected dlq to be empty after Purge, got %d entries", len(dlq.List()))
+	}
+}
+
+func TestDeadLetterQueueEvictsOldestAtCapacity(t *testing.T) {
+	dlq := newDeadLetterQueue("")
+	dlq.capacity = 2
+
+	first := newRetryTask("peer1", &ReplicationInstance{AppName: "app", Id: "inst-1", Action: actionCancel}, gossipEnvelope{})
+	second := newRetryTask("peer1", &ReplicationInstance{AppName: "app", Id: "inst-2", Action: actionCancel}, gossipEnvelope{})
+	third := newRetryTask("peer1", &ReplicationInstance{AppName: "app", Id: "inst-3", Action: actionCancel}, gossipEnvelope{})
+	dlq.Add(first)
+	dlq.Add(second)
+	dlq.Add(third)
+
+	list := dlq.List()
+	if len(list) != 2 {
+		t.Fatalf("List() returned %d entries, want 2 (capacity)", len(list))
+	}
+	if dlq.Remove(dlqTaskID(first)) != nil {
+		t.Errorf("oldest entry %q should have been evicted to stay within capacity", dlqTaskID(first))
+	}
+	if dlq.Remove(dlqTaskID(third)) == nil {
+		t.Errorf("most recent entry %q should still be present", dlqTaskID(third))
+	}
+}
@@ -0,0 +1,153 @@
+/**
+ * Tencent is pleased to support the open source community by making Polaris available.
+ *
+ * Copyright (C) 2019 THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * Licensed under the BSD 3-Clause License (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * https://opensource.org/licenses/BSD-3-Clause
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package eurekaserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	api "github.com/polarismesh/polaris/common/api/v1"
+)
+
+const (
+	replicationPeerPath = "/eureka/v1/peerreplication/batch"
+	defaultPeerTimeout  = 5 * time.Second
+)
+
+// replicateWorker fans locally-originated instance changes out to every configured peer
+// and carries out gossip re-forwarding on behalf of dispatch. Every send goes through
+// sendWithEnvelope; whatever doesn't succeed outright is handed to retryQueue instead of
+// being dropped, so a transient peer outage no longer loses register/cancel/status events.
+type replicateWorker struct {
+	mu         sync.RWMutex
+	peers      []string
+	sourceName string
+	client     *http.Client
+	retryQueue *replicateRetryQueue
+}
+
+// newReplicateWorker builds a worker that fans out to peers and retries failed
+// deliveries with backoff, dead-lettering into dlqDir once a task exhausts its budget
+// (file spooling is skipped when dlqDir is empty). nodeID must be this node's own
+// identity, never valueIdentityName: a receiving peer's BatchReplication treats that
+// constant as "this came from myself" and drops it without ever calling dispatch, which
+// would silently swallow every peer send this worker makes.
+func newReplicateWorker(peers []string, nodeID string, dlqDir string) *replicateWorker {
+	w := &replicateWorker{
+		peers:      peers,
+		sourceName: nodeID,
+		client:     &http.Client{Timeout: defaultPeerTimeout},
+	}
+	w.retryQueue = newReplicateRetryQueue(dlqDir, w.sendToPeer)
+	return w
+}
+
+// AddReplicateTask fans instance out to every configured peer. This is the star-broadcast
+// path used for locally-originated events (handleInstanceEvent); each peer send that
+// fails or comes back non-terminal is hatched at retryQueue instead of being dropped.
+func (w *replicateWorker) AddReplicateTask(instance *ReplicationInstance) {
+	w.mu.RLock()
+	peers := append([]string(nil), w.peers...)
+	w.mu.RUnlock()
+	for _, peer := range peers {
+		w.AddReplicateTaskToPeer(peer, instance, gossipEnvelope{})
+	}
+}
+
+// AddReplicateTaskToPeer sends instance to a single peer, attaching envelope as the
+// X-Polaris-Gossip header when it carries an origin (gossip re-forwarding); a zero-value
+// envelope (the star-broadcast case) is sent without the header. On failure, or on a
+// non-terminal result code, the task is enqueued on retryQueue for backoff redelivery.
+func (w *replicateWorker) AddReplicateTaskToPeer(peer string, instance *ReplicationInstance, envelope gossipEnvelope) {
+	code, err := w.sendWithEnvelope(peer, instance, envelope)
+	if err == nil && isTerminalReplicateCode(instance.Action, code) {
+		return
+	}
+	if err == nil {
+		err = fmt.Errorf("replicate to %s returned code %d", peer, code)
+	}
+	w.retryQueue.Enqueue(peer, instance, envelope, err)
+}
+
+// sendToPeer is the redelivery function handed to the retry queue. It resends with the
+// same envelope the original send carried (zero-value for star-broadcast, populated for a
+// gossip re-forward), so a retried redelivery still carries its routing metadata instead of
+// reappearing at the next peer as a fresh hop-0 delivery.
+func (w *replicateWorker) sendToPeer(peer string, instance *ReplicationInstance, envelope gossipEnvelope) (uint32, error) {
+	return w.sendWithEnvelope(peer, instance, envelope)
+}
+
+// sendWithEnvelope POSTs instance to peer's BatchReplication endpoint and maps the HTTP
+// response onto the api result codes dispatch already special-cases (ExecuteSuccess,
+// NotFoundResource for a cancel of an instance the peer never had, everything else is
+// treated as a transient ExecuteException worth retrying).
+func (w *replicateWorker) sendWithEnvelope(
+	peer string, instance *ReplicationInstance, envelope gossipEnvelope) (uint32, error) {
+	body, err := json.Marshal(&ReplicationList{ReplicationList: []*ReplicationInstance{instance}})
+	if err != nil {
+		return 0, fmt.Errorf("fail to marshal replication instance %s: %w", instance.Id, err)
+	}
+	httpReq, err := http.NewRequest(http.MethodPost, peer+replicationPeerPath, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("fail to build replication request to %s: %w", peer, err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set(headerIdentityName, w.sourceName)
+	if envelope.OriginNodeID != "" {
+		envelopeJSON, marshalErr := json.Marshal(envelope)
+		if marshalErr == nil {
+			httpReq.Header.Set(headerGossipEnvelope, string(envelopeJSON))
+		}
+	}
+
+	resp, err := w.client.Do(httpReq)
+	if err != nil {
+		return 0, fmt.Errorf("fail to replicate instance %s to %s: %w", instance.Id, peer, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return api.ExecuteSuccess, nil
+	case http.StatusNotFound:
+		return api.NotFoundResource, nil
+	default:
+		return api.ExecuteException, nil
+	}
+}
+
+// Get performs a plain GET against url (used by gossip anti-entropy to fetch a peer's
+// digest) and returns the raw response body, reusing this worker's HTTP client rather
+// than standing up a second one just for that call.
+func (w *replicateWorker) Get(url string) ([]byte, error) {
+	resp, err := w.client.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("fail to GET %s: %w", url, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("peer %s returned status %d", url, resp.StatusCode)
+	}
+	return io.ReadAll(resp.Body)
+}
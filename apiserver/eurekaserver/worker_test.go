@@ -0,0 +1,125 @@
+/**
+ * Tencent is pleased to support the open source community by making Polaris available.
+ *
+ * Copyright (C) 2019 THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * Licensed under the BSD 3-Clause License (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * https://opensource.org/licenses/BSD-3-Clause
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package eurekaserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	api "github.com/polarismesh/polaris/common/api/v1"
+)
+
+// TestReplicateWorkerSendsOwnNodeIdentityNotServerSentinel guards against a regression
+// where every outbound peer call carried the same DiscoveryIdentity-Name header
+// (valueIdentityName) that a receiving node's own BatchReplication uses to recognize and
+// drop self-originated traffic without ever calling dispatch. The fake peer below mirrors
+// that exact guard, so this fails if sendWithEnvelope ever again hardcodes the sentinel
+// instead of this node's own identity.
+func TestReplicateWorkerSendsOwnNodeIdentityNotServerSentinel(t *testing.T) {
+	var dispatched bool
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(headerIdentityName) == valueIdentityName {
+			// mirrors BatchReplication's "we should not process the replication from
+			// polaris" guard: respond 200 without ever touching dispatch.
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		dispatched = true
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer peer.Close()
+
+	worker := newReplicateWorker([]string{peer.URL}, "node-a", "")
+	code, err := worker.sendToPeer(peer.URL, &ReplicationInstance{AppName: "app", Id: "inst-1", Action: actionHeartbeat}, gossipEnvelope{})
+	if err != nil {
+		t.Fatalf("sendToPeer() error = %v", err)
+	}
+	if code != api.ExecuteSuccess {
+		t.Fatalf("sendToPeer() code = %d, want ExecuteSuccess", code)
+	}
+	if !dispatched {
+		t.Fatalf("peer send carried the %q sentinel identity and would be silently dropped "+
+			"by BatchReplication's self-traffic guard instead of being applied", valueIdentityName)
+	}
+}
+
+func TestReplicateWorkerSendWithEnvelopeCarriesGossipHeaderOnlyWhenOriginSet(t *testing.T) {
+	var gotHeader string
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHeader = r.Header.Get(headerGossipEnvelope)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer peer.Close()
+
+	worker := newReplicateWorker([]string{peer.URL}, "node-a", "")
+	if _, err := worker.sendWithEnvelope(peer.URL, &ReplicationInstance{Action: actionHeartbeat}, gossipEnvelope{}); err != nil {
+		t.Fatalf("sendWithEnvelope() error = %v", err)
+	}
+	if gotHeader != "" {
+		t.Errorf("a zero-value envelope should not set %s, got %q", headerGossipEnvelope, gotHeader)
+	}
+
+	if _, err := worker.sendWithEnvelope(peer.URL, &ReplicationInstance{Action: actionHeartbeat},
+		gossipEnvelope{OriginNodeID: "node-b", HopCount: 1}); err != nil {
+		t.Fatalf("sendWithEnvelope() error = %v", err)
+	}
+	if gotHeader == "" {
+		t.Errorf("an envelope with an origin should set %s", headerGossipEnvelope)
+	}
+}
+
+// TestReplicateWorkerRetriesGossipForwardWithOriginalEnvelope guards against a regression
+// where a failed gossip re-forward lost its routing metadata on retry: sendToPeer always
+// resent with a bare gossipEnvelope{}, so a hop-2 forwarded update that
+// needed a retry would reappear at the next peer as a fresh hop-0 delivery with a
+// fallback-derived clock, defeating maxHops and causal ordering.
+func TestReplicateWorkerRetriesGossipForwardWithOriginalEnvelope(t *testing.T) {
+	var gotHeaders []string
+	var calls int
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		gotHeaders = append(gotHeaders, r.Header.Get(headerGossipEnvelope))
+		if calls == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer peer.Close()
+
+	worker := newReplicateWorker([]string{peer.URL}, "node-a", "")
+	envelope := gossipEnvelope{OriginNodeID: "node-b", HopCount: 2, VectorClock: vectorClock{"node-b": 5}}
+	worker.AddReplicateTaskToPeer(peer.URL, &ReplicationInstance{AppName: "app", Id: "inst-1", Action: actionHeartbeat}, envelope)
+
+	// the first backoff delay is jittered by up to +50% of defaultRetryInitialInterval
+	time.Sleep(2 * defaultRetryInitialInterval)
+	worker.retryQueue.drainDue()
+
+	if calls != 2 {
+		t.Fatalf("expected the retry queue to redeliver once the task became due, got %d calls", calls)
+	}
+	if gotHeaders[0] != gotHeaders[1] {
+		t.Errorf("retry should resend the exact same %s header as the original failed send, got %q then %q",
+			headerGossipEnvelope, gotHeaders[0], gotHeaders[1])
+	}
+	if gotHeaders[1] == "" {
+		t.Errorf("retried gossip forward lost its envelope and was resent as a bare hop-0 delivery")
+	}
+}